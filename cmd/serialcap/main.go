@@ -0,0 +1,46 @@
+// Command serialcap decodes a serial capture written by
+// regenbox.PcapWriter (see SerialConnection.SetMirror / --serial-log),
+// printing one line per record.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/solar3s/goregen/regenbox"
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: serialcap <capture-file>")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := regenbox.NewPcapReader(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		t := time.Unix(0, rec.Ns)
+		fmt.Printf("%s %-5s % x  %q\n", t.Format(time.RFC3339Nano), rec.Dir, rec.Payload, string(rec.Payload))
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"time"
+)
+
+// dumpDiagnostics writes rbox's current snapshot and a goroutine profile
+// to <root>/diagnostics/<timestamp>-*, for troubleshooting a running
+// instance without having to restart it (triggered by SIGUSR1).
+func dumpDiagnostics(root string) {
+	dir := filepath.Join(root, "diagnostics")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("diagnostics: couldn't mkdir %q: %s", dir, err)
+		return
+	}
+	stamp := time.Now().Format("20060102-150405")
+
+	snapPath := filepath.Join(dir, stamp+"-snapshot.json")
+	if f, err := os.Create(snapPath); err != nil {
+		log.Printf("diagnostics: couldn't create %q: %s", snapPath, err)
+	} else {
+		if server != nil && server.Regenbox != nil {
+			fmt.Fprintf(f, "%+v\n", server.Regenbox.Snapshot())
+		}
+		f.Close()
+	}
+
+	profPath := filepath.Join(dir, stamp+"-goroutines.prof")
+	if f, err := os.Create(profPath); err != nil {
+		log.Printf("diagnostics: couldn't create %q: %s", profPath, err)
+	} else {
+		pprof.Lookup("goroutine").WriteTo(f, 2)
+		f.Close()
+	}
+
+	log.Printf("diagnostics: dumped snapshot and goroutine profile to %q", dir)
+}
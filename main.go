@@ -1,19 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/rkjdid/util"
 	"github.com/solar3s/goregen/regenbox"
+	"github.com/solar3s/goregen/regenbox/netserial"
 	"github.com/solar3s/goregen/web"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"syscall"
 	"time"
 )
 
+// shutdownTimeout bounds how long the shutdown sequence triggered by
+// SIGTERM/SIGINT may take before each layer gives up on its own stage.
+const shutdownTimeout = time.Second * 10
+
 var (
 	conn   *regenbox.SerialConnection
 	server *web.Server
@@ -30,8 +37,16 @@ var (
 	debug   = flag.Bool("debug", false, "enable debug mode")
 	assets  = flag.Bool("assets", false, "extract static assets to <root>/static, if true, extracted assets "+
 		"also take precedence over binary assets\n\tthis option is useful for doing live tests on front-end")
+	serialLog = flag.String("serial-log", "", "capture all serial traffic to this path, decode later with serialcap")
+
+	serveSerial  = flag.String("serve-serial", "", "serve the local serial connection to one remote client on this address, e.g. :4646; runs goregen as a bridge only, without driving a local regenbox")
+	remoteSerial = flag.String("remote-serial", "", "drive a regenbox served by --serve-serial on a remote host, e.g. host:4646")
+
+	discover = flag.Bool("discover", false, "probe every serial port for regenboxes and manage all of them via regenbox.Manager, instead of a single --dev box")
 )
 
+var netserialSrv *netserial.Server
+
 func UserHomeDir() string {
 	if runtime.GOOS == "windows" {
 		home := os.Getenv("HOMEDRIVE") + os.Getenv("HOMEPATH")
@@ -50,13 +65,42 @@ func init() {
 		os.Exit(0)
 	}
 
-	if *device != "" {
+	// --discover has regenbox.Manager open and own every responsive port
+	// itself; opening *device here too would leave it open and unused
+	// by runMultiBox, and fighting the manager for the same path since
+	// most OS serial drivers refuse a second concurrent open.
+	if *device != "" && *discover {
+		log.Printf("--discover is set, ignoring --dev=%q: the manager probes and opens ports itself", *device)
+	}
+	if *device != "" && !*discover {
 		port, config, err := regenbox.OpenPortName(*device)
 		if err != nil {
 			log.Fatal("error opening serial port: ", err)
 		}
 		conn = regenbox.NewSerial(port, config, *device)
 		conn.Start()
+
+		if *serialLog != "" {
+			pcap, err := regenbox.NewPcapWriter(*serialLog)
+			if err != nil {
+				log.Fatalf("couldn't create serial capture \"%s\": %s", *serialLog, err)
+			}
+			conn.SetMirror(pcap)
+		}
+
+		if *serveSerial != "" {
+			srv, err := netserial.NewServer(*serveSerial, conn, nil)
+			if err != nil {
+				log.Fatalf("couldn't serve serial on \"%s\": %s", *serveSerial, err)
+			}
+			netserialSrv = srv
+			go func() {
+				if err := srv.Serve(); err != nil {
+					log.Printf("netserial server stopped: %s", err)
+				}
+			}()
+			log.Printf("serving serial connection on %s", *serveSerial)
+		}
 	}
 
 	if *root == "" || *root == "~/.goregen" {
@@ -99,7 +143,30 @@ func init() {
 }
 
 func main() {
-	rbox, err := regenbox.NewRegenBox(conn, &rbCfg)
+	// --serve-serial hands the one local conn exclusively to netserialSrv;
+	// running a local RegenBox against it at the same time would have
+	// both sides racing to read/write the same single-reader channels.
+	if netserialSrv != nil {
+		serveOnly()
+		return
+	}
+
+	if *discover {
+		runMultiBox()
+		return
+	}
+
+	var rbConn regenbox.Conn = conn
+	if *remoteSerial != "" {
+		remote, err := netserial.NewNetSerial(*remoteSerial)
+		if err != nil {
+			log.Fatalf("couldn't reach remote serial \"%s\": %s", *remoteSerial, err)
+		}
+		rbConn = remote
+		log.Printf("driving remote serial connection at %s", *remoteSerial)
+	}
+
+	rbox, err := regenbox.NewRegenBox(rbConn, &rbCfg)
 	if err != nil {
 		log.Println("error initializing regenbox connection:", err)
 	}
@@ -120,23 +187,131 @@ func main() {
 	}
 	server.Start()
 
-	trap := make(chan os.Signal)
-	signal.Notify(trap, os.Kill, os.Interrupt)
-	<-trap
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	diag := make(chan os.Signal, 1)
+	signal.Notify(diag, syscall.SIGUSR1)
+
+	for {
+		select {
+		case <-diag:
+			dumpDiagnostics(*root)
+		case <-reload:
+			log.Println("SIGHUP received, reloading config...")
+			newCfg := regenbox.DefaultConfig
+			if err := util.ReadTomlFile(&newCfg, *cfg); err != nil {
+				log.Printf("error reloading config \"%s\": %s", *cfg, err)
+				continue
+			}
+			if err := rbox.UpdateConfig(&newCfg); err != nil {
+				log.Printf("error applying reloaded config: %s", err)
+				continue
+			}
+			rbCfg = newCfg
+			log.Println("config reloaded")
+		case <-quit:
+			fmt.Println()
+			log.Println("quit received, shutting down...")
+			shutdown(rbox, watcher)
+			return
+		}
+	}
+}
+
+// runMultiBox runs goregen against every responsive regenbox found on
+// the machine via regenbox.Manager, instead of the single --dev box.
+// The web UI's single-box routes are wired to one of the boxes found by
+// the manager's initial scan (whichever mgr.IDs lists first, in no
+// defined order), for backward compatibility; boxes discovered later are
+// not reachable through them. web.Server has no per-box /api/boxes routes.
+func runMultiBox() {
+	mgr := regenbox.NewManager(regenbox.ManagerConfig{Discover: true})
+	mgr.Start()
+
+	server = &web.Server{
+		ListenAddr: "localhost:3636",
+		Verbose:    *verbose,
+		Debug:      *debug,
+		RboxConfig: *cfg,
+		RootDir:    *root,
+		StaticDir:  static,
+		WsInterval: time.Second * 5,
+		Version:    Version,
+	}
+	if ids := mgr.IDs(); len(ids) > 0 {
+		if box, err := mgr.Get(ids[0]); err == nil {
+			server.Regenbox = box
+		}
+		log.Printf("multi-box mode: managing %d box(es): %v", len(ids), ids)
+	} else {
+		log.Println("multi-box mode: no regenbox found yet, still probing in the background")
+	}
+	server.Start()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
 	fmt.Println()
-	log.Println("quit received...")
+	log.Println("quit received, shutting down...")
 
-	cleanExit := make(chan struct{})
-	go func() {
-		watcher.Stop()
-		rbox.Stop()
-		rbox.Conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: http server: %s", err)
+	}
+	mgr.Stop()
+	log.Println("clean exit")
+}
 
-		close(cleanExit)
-	}()
-	select {
-	case <-time.After(time.Second * 10):
-		log.Panicln("no clean exit after 10sec, please report panic log to https://github.com/solar3s/goregen/issues")
-	case <-cleanExit:
+// serveOnly runs goregen purely as a netserial bridge for *device: no
+// local RegenBox/Watcher/web.Server is started, since they'd otherwise
+// contend with netserialSrv for the one local conn.
+func serveOnly() {
+	log.Printf("running as a serial bridge only (--serve-serial set); not driving a local regenbox")
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	fmt.Println()
+	log.Println("quit received, shutting down...")
+
+	if err := netserialSrv.Close(); err != nil {
+		log.Printf("shutdown: netserial server: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := conn.CloseContext(ctx); err != nil {
+		log.Printf("shutdown: serial connection: %s", err)
+	}
+	log.Println("clean exit")
+}
+
+// shutdown runs the shutdown sequence for server, watcher and rbox, each
+// stage bounded by shutdownTimeout so a stuck layer is logged by name
+// instead of hanging the whole process.
+func shutdown(rbox *regenbox.RegenBox, watcher *regenbox.Watcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: http server: %s", err)
+	}
+	if err := watcher.StopContext(ctx); err != nil {
+		log.Printf("shutdown: watcher: %s", err)
+	}
+	if err := rbox.StopContext(ctx); err != nil {
+		log.Printf("shutdown: regenbox: %s", err)
+	}
+	var connErr error
+	if cc, ok := rbox.Conn.(interface{ CloseContext(context.Context) error }); ok {
+		connErr = cc.CloseContext(ctx)
+	} else {
+		connErr = rbox.Conn.Close()
+	}
+	if connErr != nil {
+		log.Printf("shutdown: serial connection: %s", connErr)
 	}
+	log.Println("clean exit")
 }
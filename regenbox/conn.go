@@ -0,0 +1,13 @@
+package regenbox
+
+// Conn is the surface RegenBox needs from its link to the hardware: the
+// subset of SerialConnection's methods it uses. It exists so alternative
+// transports (netserial.NetSerial, over TCP) can stand in for a local
+// SerialConnection without RegenBox knowing the difference.
+type Conn interface {
+	Read() ([]byte, error)
+	Write(b []byte) error
+	Close() error
+	Closed() <-chan struct{}
+	Path() string
+}
@@ -0,0 +1,158 @@
+package regenbox
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// StopByte terminates a frame under StopByteFramer. It is kept around
+// (rather than folded into framer.go's Framer implementations) since it
+// used to be the only framing scheme SerialConnection understood.
+const StopByte = 0x0A
+
+// ErrBadCRC is returned by Framer.Decode implementations that append a
+// checksum to their frames, when the computed CRC doesn't match.
+var ErrBadCRC = errors.New("regenbox: bad frame CRC")
+
+// Framer encodes payloads into wire frames and decodes frames read off
+// a serial port back into payloads. SerialConnection.Framer defaults to
+// StopByteFramer for backward compatibility with the original protocol.
+type Framer interface {
+	Encode(payload []byte) []byte
+	Decode(r io.Reader) ([]byte, error)
+}
+
+// DefaultFramer is used by NewSerial unless overridden via
+// SerialConnection.Framer.
+var DefaultFramer Framer = StopByteFramer{}
+
+// StopByteFramer is the original framing scheme: a frame is terminated
+// by a single StopByte. It has no escaping, so a StopByte occurring in
+// the payload truncates the frame, and frames are capped at 32 bytes.
+type StopByteFramer struct{}
+
+func (StopByteFramer) Encode(payload []byte) []byte {
+	return append(append([]byte{}, payload...), StopByte)
+}
+
+func (StopByteFramer) Decode(r io.Reader) ([]byte, error) {
+	b := make([]byte, 32)
+	i, err := r.Read(b)
+
+	j := i
+	for err == nil && j > 0 && b[i-1] != StopByte {
+		j, err = r.Read(b[i:])
+		i += j
+	}
+
+	if i > 0 && b[i-1] == StopByte {
+		i -= 1
+	}
+	return b[:i], err
+}
+
+// CobsFramer frames payloads with Consistent Overhead Byte Stuffing plus
+// a trailing CRC-16/CCITT, so zero bytes and arbitrarily large payloads
+// can be transmitted without ambiguity. Every encoded frame is terminated
+// by a literal 0x00 delimiter.
+type CobsFramer struct{}
+
+func (CobsFramer) Encode(payload []byte) []byte {
+	crc := crc16CCITT(payload)
+	buf := append(append([]byte{}, payload...), byte(crc>>8), byte(crc))
+	return append(cobsEncode(buf), 0x00)
+}
+
+func (CobsFramer) Decode(r io.Reader) ([]byte, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	raw, err := br.ReadBytes(0x00)
+	if err != nil {
+		return nil, err
+	}
+	raw = raw[:len(raw)-1] // drop delimiter
+	buf, err := cobsDecode(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 2 {
+		return nil, ErrBadCRC
+	}
+	payload, wantCRC := buf[:len(buf)-2], uint16(buf[len(buf)-2])<<8|uint16(buf[len(buf)-1])
+	if crc16CCITT(payload) != wantCRC {
+		return nil, ErrBadCRC
+	}
+	return payload, nil
+}
+
+// cobsEncode implements Consistent Overhead Byte Stuffing: it splits src
+// on zero bytes and prefixes each resulting block with a one-byte
+// distance to the next zero (or 0xFF if the block is longer than that).
+func cobsEncode(src []byte) []byte {
+	dst := make([]byte, 0, len(src)+len(src)/254+1)
+	for len(src) > 0 {
+		n := 0
+		for n < len(src) && n < 0xFF-1 && src[n] != 0 {
+			n++
+		}
+		dst = append(dst, byte(n+1))
+		dst = append(dst, src[:n]...)
+		// Only consume the next byte as "the zero this block's code
+		// implies" when the inner loop actually stopped because it saw
+		// one. If it stopped at the 0xFF-1 length cap instead, src[n]
+		// may coincidentally be zero too, but that zero is real payload
+		// for the *next* block, not the implied terminator (code 0xFF
+		// means "no implied zero follows").
+		if n < 0xFF-1 && n < len(src) && src[n] == 0 {
+			src = src[n+1:]
+			// A zero at the very end of src still needs a final (empty)
+			// block after it, or cobsDecode has no pointer left to turn
+			// into that zero and the payload comes back one byte short.
+			if len(src) == 0 {
+				dst = append(dst, 0x01)
+			}
+		} else {
+			src = src[n:]
+		}
+	}
+	return dst
+}
+
+// cobsDecode is the inverse of cobsEncode: it walks the pointer chain,
+// replacing each pointer with a zero byte except the last one (unless
+// that last pointer was 0xFF, in which case no zero follows).
+func cobsDecode(src []byte) ([]byte, error) {
+	dst := make([]byte, 0, len(src))
+	for i := 0; i < len(src); {
+		code := int(src[i])
+		if code == 0 || i+code > len(src) {
+			return nil, errors.New("regenbox: malformed cobs frame")
+		}
+		dst = append(dst, src[i+1:i+code]...)
+		i += code
+		if code < 0xFF && i < len(src) {
+			dst = append(dst, 0x00)
+		}
+	}
+	return dst, nil
+}
+
+// crc16CCITT computes CRC-16/CCITT-FALSE (poly 0x1021, init 0xFFFF) over
+// b, matching the firmware-side checksum.
+func crc16CCITT(b []byte) uint16 {
+	var crc uint16 = 0xFFFF
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
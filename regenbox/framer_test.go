@@ -0,0 +1,98 @@
+package regenbox
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestCobsRoundTrip(t *testing.T) {
+	cases := [][]byte{
+		nil,
+		{},
+		{0x01},
+		{0x00},
+		{0x00, 0x00, 0x00},
+		{0x01, 0x00, 0x02, 0x00, 0x03},
+		bytes.Repeat([]byte{0xAA}, 253),
+		bytes.Repeat([]byte{0xAA}, 254),
+		bytes.Repeat([]byte{0xAA}, 255),
+		bytes.Repeat([]byte{0xAA}, 260),
+		bytes.Repeat([]byte{0xAA}, 600),
+		append(bytes.Repeat([]byte{0xAA}, 254), 0x00, 0xBB, 0xCC),
+	}
+	for _, payload := range cases {
+		encoded := cobsEncode(payload)
+		for _, b := range encoded {
+			if b == 0x00 {
+				t.Fatalf("cobsEncode(%d bytes): delimiter byte leaked into encoded frame", len(payload))
+			}
+		}
+		decoded, err := cobsDecode(encoded)
+		if err != nil {
+			t.Fatalf("cobsDecode(cobsEncode(%d bytes)): %s", len(payload), err)
+		}
+		if !bytes.Equal(decoded, payload) && !(len(decoded) == 0 && len(payload) == 0) {
+			t.Fatalf("round-trip mismatch for %d-byte payload: got %v", len(payload), decoded)
+		}
+	}
+}
+
+func TestCobsEncodeLongRunDoesNotOverflowCodeByte(t *testing.T) {
+	encoded := cobsEncode(bytes.Repeat([]byte{0xAA}, 260))
+	if encoded[0] == 0x00 {
+		t.Fatalf("first code byte overflowed to 0x00")
+	}
+}
+
+func TestCobsEncodeZeroAtLengthCapBoundary(t *testing.T) {
+	// A 254-byte non-zero run hits cobsEncode's length cap on the same
+	// byte that happens to be a real 0x00 in the source; that zero must
+	// still show up in the decoded payload, not be silently swallowed.
+	payload := append(bytes.Repeat([]byte{0xAA}, 254), 0x00, 0xBB, 0xCC)
+	decoded, err := cobsDecode(cobsEncode(payload))
+	if err != nil {
+		t.Fatalf("cobsDecode: %s", err)
+	}
+	if !bytes.Equal(decoded, payload) {
+		t.Fatalf("got %v, want %v", decoded, payload)
+	}
+}
+
+func TestCobsDecodeTruncatedFrame(t *testing.T) {
+	_, err := cobsDecode([]byte{4, 0x11, 0x22})
+	if err == nil {
+		t.Fatal("expected an error decoding a truncated frame, got nil")
+	}
+}
+
+func TestCobsFramerDecodeBadCRC(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(cobsEncode([]byte{0x01, 0x02, 0xFF, 0xFF})) // bogus trailing "crc"
+	buf.WriteByte(0x00)
+
+	_, err := (CobsFramer{}).Decode(bufio.NewReader(&buf))
+	if err != ErrBadCRC {
+		t.Fatalf("expected ErrBadCRC, got %v", err)
+	}
+}
+
+func TestCobsFramerRoundTrip(t *testing.T) {
+	f := CobsFramer{}
+	payload := []byte{0x00, 0x01, 0x02, 0x00, 0xFF}
+
+	var buf bytes.Buffer
+	buf.Write(f.Encode(payload))
+	buf.Write(f.Encode(payload))
+
+	br := bufio.NewReader(&buf)
+	for i := 0; i < 2; i++ {
+		got, err := f.Decode(br)
+		if err != nil {
+			t.Fatalf("frame %d: %s", i, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("frame %d: got %v, want %v", i, got, payload)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package regenbox
+
+import (
+	"errors"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultBoxID is the key AddFromPath registers a box under when it is
+// given neither an ID nor a Path, and the key Add uses for an empty id
+// while the Manager holds no box yet. Boxes found by discovery are
+// registered under their port path, never under DefaultBoxID.
+const DefaultBoxID = "default"
+
+var ErrUnknownBox = errors.New("regenbox: no such box")
+var ErrBoxExists = errors.New("regenbox: box already registered")
+
+// DefaultDiscoverInterval is how often Manager.discoverRoutine rescans
+// available serial ports for new boxes when Discover is enabled.
+var DefaultDiscoverInterval = time.Second * 10
+
+// BoxConfig describes one entry of a manager's [[boxes]] TOML array:
+// where to find it, what to call it, and which charging profile to use.
+type BoxConfig struct {
+	// ID is the key the box is registered and addressed under, e.g. in
+	// /api/boxes/{id}/*. Defaults to Path if empty.
+	ID string
+
+	// Path is the serial device to open, e.g. "/dev/ttyUSB0". Left empty
+	// together with Manager.Config.Discover, the box is found by probing.
+	Path string
+
+	// Name is an optional human-friendly label shown in the web UI.
+	Name string
+
+	Config Config
+}
+
+// ManagerConfig is the top-level TOML config for a Manager: a static
+// list of boxes, plus an optional discovery mode for the rest.
+type ManagerConfig struct {
+	Boxes []BoxConfig
+
+	// Discover periodically probes every unclaimed serial port with
+	// TestConnection and auto-registers the ones that respond.
+	Discover bool
+}
+
+// managedBox bundles everything a Manager tracks for one registered box.
+type managedBox struct {
+	id      string
+	name    string
+	box     *RegenBox
+	watcher *Watcher
+}
+
+// Manager owns a bank of RegenBox instances, each with its own Conn,
+// Config and Watcher, keyed by an arbitrary box ID (usually the serial
+// port path). It is the multi-box generalization of main.go wiring a
+// single RegenBox + Watcher directly.
+type Manager struct {
+	mu      sync.RWMutex
+	boxes   map[string]*managedBox
+	cfg     ManagerConfig
+	closeCh chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewManager builds an (unstarted) Manager from cfg. Call Start to open
+// the configured boxes and, if cfg.Discover is set, begin probing for more.
+func NewManager(cfg ManagerConfig) *Manager {
+	return &Manager{
+		boxes:   make(map[string]*managedBox),
+		cfg:     cfg,
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Start opens every statically configured box and, if enabled, runs an
+// immediate discovery scan before launching the periodic one. Errors
+// opening individual boxes are logged rather than fatal, mirroring
+// FindSerial's best-effort probing.
+func (m *Manager) Start() {
+	for _, bc := range m.cfg.Boxes {
+		if err := m.AddFromPath(bc.ID, bc.Name, bc.Path, bc.Config); err != nil {
+			log.Printf("manager: couldn't add box %q (%s): %s", bc.ID, bc.Path, err)
+		}
+	}
+	if m.cfg.Discover {
+		m.probeNewPorts()
+		m.wg.Add(1)
+		go func() {
+			m.discoverRoutine()
+			m.wg.Done()
+		}()
+	}
+}
+
+// Stop stops every managed box's watcher, closes its connection, and
+// terminates the discovery loop.
+func (m *Manager) Stop() {
+	close(m.closeCh)
+	m.wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, mb := range m.boxes {
+		mb.watcher.Stop()
+		mb.box.Stop()
+		mb.box.Conn.Close()
+		delete(m.boxes, id)
+	}
+}
+
+// AddFromPath opens path (or probes for any responsive port if path is
+// empty), wraps it in a RegenBox+Watcher pair, and registers it under id
+// (defaulting to path, or to DefaultBoxID if path is empty too).
+func (m *Manager) AddFromPath(id, name, path string, cfg Config) error {
+	var conn *SerialConnection
+	var err error
+	if path != "" {
+		var port serial.Port
+		var mode serial.Mode
+		port, mode, err = OpenPortName(path)
+		if err != nil {
+			return err
+		}
+		conn = NewSerial(port, mode, path, false)
+		conn.Start()
+	} else {
+		conn, err = FindSerial(nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if id == "" {
+		id = path
+	}
+	if id == "" {
+		id = DefaultBoxID
+	}
+
+	box, err := NewRegenBox(conn, &cfg)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return m.Add(id, name, box)
+}
+
+// Add registers an already-constructed RegenBox (with its own Conn and
+// Config) under id, starting a Watcher for it.
+func (m *Manager) Add(id, name string, box *RegenBox) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.boxes) == 0 && id == "" {
+		id = DefaultBoxID
+	}
+	if _, ok := m.boxes[id]; ok {
+		return fmt.Errorf("%w: %s", ErrBoxExists, id)
+	}
+	watcher := NewWatcher(box, DefaultWatcherConfig)
+	watcher.WatchConn()
+	m.boxes[id] = &managedBox{id: id, name: name, box: box, watcher: watcher}
+	return nil
+}
+
+// Remove stops and unregisters the box known as id.
+func (m *Manager) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mb, ok := m.boxes[id]
+	if !ok {
+		return ErrUnknownBox
+	}
+	mb.watcher.Stop()
+	mb.box.Stop()
+	mb.box.Conn.Close()
+	delete(m.boxes, id)
+	return nil
+}
+
+// Get returns the RegenBox registered as id.
+func (m *Manager) Get(id string) (*RegenBox, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mb, ok := m.boxes[id]
+	if !ok {
+		return nil, ErrUnknownBox
+	}
+	return mb.box, nil
+}
+
+// IDs returns every currently registered box ID.
+func (m *Manager) IDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, 0, len(m.boxes))
+	for id := range m.boxes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// discoverRoutine periodically enumerates available serial ports and
+// registers any unclaimed one that answers TestConnection.
+func (m *Manager) discoverRoutine() {
+	t := time.NewTicker(DefaultDiscoverInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.closeCh:
+			return
+		case <-t.C:
+			m.probeNewPorts()
+		}
+	}
+}
+
+// probeNewPorts re-probes every unclaimed serial port on each scan,
+// rather than remembering and skipping ports that failed before: a
+// port that didn't answer TestConnection on one scan (e.g. an unrelated
+// device was plugged into it at the time) may have a real regenbox on
+// it by the next one, at the same path. probeAndAdd's short timeouts
+// keep repeatedly probing an unresponsive port cheap.
+func (m *Manager) probeNewPorts() {
+	ports, err := serial.GetPortsList()
+	if err != nil {
+		log.Printf("manager: discover: %s", err)
+		return
+	}
+	for _, path := range ports {
+		// A box may be registered under an ID other than its port path,
+		// so match on each box's connection path, not just the map key.
+		m.mu.RLock()
+		_, claimed := m.boxes[path]
+		for _, mb := range m.boxes {
+			if mb.box.Conn.Path() == path {
+				claimed = true
+				break
+			}
+		}
+		m.mu.RUnlock()
+		if claimed {
+			continue
+		}
+
+		if err := m.probeAndAdd(path); err != nil {
+			log.Printf("manager: discover: %q not a regenbox: %s", path, err)
+			continue
+		}
+		log.Printf("manager: discovered box on %q", path)
+	}
+}
+
+// probeAndAdd opens path, verifies it actually answers TestConnection
+// (the same check FindSerial runs over every port), and only then
+// registers it. Unlike AddFromPath, it never registers an unresponsive
+// port just because it happened to open.
+func (m *Manager) probeAndAdd(path string) error {
+	port, mode, err := OpenPortName(path)
+	if err != nil {
+		return err
+	}
+	conn := NewSerial(port, mode, path, false)
+	conn.ReadTimeout = time.Millisecond * 50
+	conn.WriteTimeout = time.Millisecond * 50
+	conn.Reconnect.Enabled = false
+	conn.Start()
+
+	rb := &RegenBox{Conn: conn, config: new(Config), state: Connected}
+	if _, err := rb.TestConnection(); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.ReadTimeout = DefaultTimeout
+	conn.WriteTimeout = DefaultTimeout
+	conn.Reconnect = DefaultReconnectConfig
+
+	cfg := DefaultConfig
+	box, err := NewRegenBox(conn, &cfg)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return m.Add(path, "", box)
+}
@@ -0,0 +1,125 @@
+package regenbox
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// Direction tags which way a mirrored record travelled on the wire.
+type Direction byte
+
+const (
+	DirRead Direction = iota
+	DirWrite
+)
+
+func (d Direction) String() string {
+	if d == DirWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// mirrorRecord is one tee'd copy of bytes read from or written to the
+// underlying serial port, stamped with the time it was observed.
+type mirrorRecord struct {
+	ns  int64
+	dir Direction
+	b   []byte
+}
+
+// mirrorBacklog bounds how many pending records SetMirror will buffer
+// before dropping a slow sink.
+const mirrorBacklog = 256
+
+// SetMirror installs w as an auxiliary, read-only sink for every raw
+// byte read from and written to sc's serial port (the bytes as they
+// cross the wire, framing/CRC and all, not the decoded Framer
+// payload), each record tagged with a timestamp and direction. Writes
+// to w happen on their own goroutine and never block sc's I/O: if w
+// falls behind past mirrorBacklog records, the mirror is dropped and a
+// warning logged, but the connection keeps running. Passing a nil
+// writer disables the mirror. Either way, the previously installed
+// writer is closed (if it implements io.Closer) once its goroutine
+// stops, so swapping or disabling a mirror doesn't leak its resources;
+// records still queued for it at that point may be discarded.
+func (sc *SerialConnection) SetMirror(w MirrorWriter) {
+	sc.mu.Lock()
+	if sc.mirrorChan != nil {
+		close(sc.mirrorStop)
+		sc.mirrorChan = nil
+	}
+	if w == nil {
+		sc.mu.Unlock()
+		return
+	}
+	ch := make(chan mirrorRecord, mirrorBacklog)
+	stop := make(chan struct{})
+	sc.mirrorChan = ch
+	sc.mirrorStop = stop
+	sc.mu.Unlock()
+
+	go func() {
+		defer closeMirror(w)
+		for {
+			select {
+			case rec := <-ch:
+				if err := w.WriteRecord(rec.ns, rec.dir, rec.b); err != nil {
+					log.Printf("serial mirror: write failed, detaching: %s", err)
+					sc.mu.Lock()
+					if sc.mirrorChan == ch {
+						sc.mirrorChan = nil
+					}
+					sc.mu.Unlock()
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// closeMirror closes w if it implements io.Closer (e.g. PcapWriter's
+// underlying file), so swapping or disabling a mirror via SetMirror
+// doesn't leak it. MirrorWriter itself doesn't require Close, since not
+// every sink owns a resource worth releasing.
+func closeMirror(w MirrorWriter) {
+	c, ok := w.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := c.Close(); err != nil {
+		log.Printf("serial mirror: close failed: %s", err)
+	}
+}
+
+// MirrorWriter is the sink half of SerialConnection.SetMirror.
+type MirrorWriter interface {
+	WriteRecord(ns int64, dir Direction, payload []byte) error
+}
+
+// tee copies b into the mirror sink, if any, without blocking the
+// caller; a full mirror channel means a slow sink, which is detached
+// (and closed by its goroutine) with a warning rather than stalling I/O.
+func (sc *SerialConnection) tee(dir Direction, b []byte) {
+	sc.mu.RLock()
+	ch := sc.mirrorChan
+	sc.mu.RUnlock()
+	if ch == nil {
+		return
+	}
+	cp := append([]byte{}, b...)
+	select {
+	case ch <- mirrorRecord{ns: time.Now().UnixNano(), dir: dir, b: cp}:
+	default:
+		log.Printf("serial mirror: backlog full, detaching slow sink")
+		sc.mu.Lock()
+		if sc.mirrorChan == ch {
+			close(sc.mirrorStop)
+			sc.mirrorChan = nil
+		}
+		sc.mu.Unlock()
+	}
+}
@@ -0,0 +1,77 @@
+package netserial
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	"github.com/solar3s/goregen/regenbox"
+)
+
+// NetSerial dials a netserial.Server and implements regenbox.Conn, so it
+// can be handed to regenbox.NewRegenBox as a drop-in replacement for a
+// local regenbox.SerialConnection.
+type NetSerial struct {
+	addr   string
+	framer regenbox.Framer
+
+	mu        sync.Mutex
+	conn      net.Conn
+	br        *bufio.Reader
+	closeChan chan struct{}
+}
+
+// NewNetSerial dials addr and returns a ready-to-use NetSerial using
+// regenbox.DefaultFramer.
+func NewNetSerial(addr string) (*NetSerial, error) {
+	return NewNetSerialFramer(addr, regenbox.DefaultFramer)
+}
+
+// NewNetSerialFramer is NewNetSerial with an explicit Framer, which must
+// match the one the remote netserial.Server was created with.
+func NewNetSerialFramer(addr string, framer regenbox.Framer) (*NetSerial, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if framer == nil {
+		framer = regenbox.DefaultFramer
+	}
+	return &NetSerial{
+		addr:      addr,
+		framer:    framer,
+		conn:      conn,
+		br:        bufio.NewReader(conn),
+		closeChan: make(chan struct{}),
+	}, nil
+}
+
+func (n *NetSerial) Read() ([]byte, error) {
+	return n.framer.Decode(n.br)
+}
+
+func (n *NetSerial) Write(b []byte) error {
+	_, err := n.conn.Write(n.framer.Encode(b))
+	return err
+}
+
+// Close closes the TCP connection to the remote server.
+func (n *NetSerial) Close() error {
+	select {
+	case <-n.closeChan:
+		return regenbox.ErrClosedPort
+	default:
+	}
+	close(n.closeChan)
+	return n.conn.Close()
+}
+
+// Closed exposes <-n.closeChan, which is closed once Close has run.
+func (n *NetSerial) Closed() <-chan struct{} {
+	return n.closeChan
+}
+
+// Path returns the "host:port" this NetSerial is bridged to.
+func (n *NetSerial) Path() string {
+	return n.addr
+}
@@ -0,0 +1,148 @@
+// Package netserial exposes a regenbox.SerialConnection over TCP, so a
+// goregen client can drive hardware plugged into a remote machine (e.g.
+// a headless Raspberry Pi sitting next to the bench) as if it were local.
+package netserial
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/solar3s/goregen/regenbox"
+)
+
+// Server accepts a single TCP client at a time and forwards framed
+// messages between it and the wrapped SerialConnection. Any additional
+// client that dials in while one is already attached is rejected outright.
+type Server struct {
+	ln     net.Listener
+	conn   *regenbox.SerialConnection
+	framer regenbox.Framer
+
+	mu      sync.Mutex
+	client  net.Conn
+	closeCh chan struct{}
+	closed  bool
+}
+
+// NewServer starts listening on addr and returns a Server that forwards
+// to conn using framer (regenbox.DefaultFramer if nil).
+func NewServer(addr string, conn *regenbox.SerialConnection, framer regenbox.Framer) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if framer == nil {
+		framer = regenbox.DefaultFramer
+	}
+	return &Server{ln: ln, conn: conn, framer: framer, closeCh: make(chan struct{})}, nil
+}
+
+// Serve accepts clients until Close is called, blocking the caller; run
+// it in its own goroutine.
+func (s *Server) Serve() error {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			select {
+			case <-s.closeCh:
+				return nil
+			default:
+				return err
+			}
+		}
+		s.mu.Lock()
+		if s.client != nil {
+			s.mu.Unlock()
+			log.Printf("netserial: rejecting %s, a client is already attached", c.RemoteAddr())
+			c.Close()
+			continue
+		}
+		s.client = c
+		s.mu.Unlock()
+
+		log.Printf("netserial: client %s attached", c.RemoteAddr())
+		go s.serveClient(c)
+	}
+}
+
+// serveClient bridges c and s.conn until either side closes.
+func (s *Server) serveClient(c net.Conn) {
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			b, err := s.conn.Read()
+			// s.conn.Read() returns a fresh "read timeout" error every
+			// ReadTimeout while the box is idle, and ErrDisconnected
+			// while reconnecting — neither means the link is actually
+			// gone, so only ErrClosedPort ends the bridge.
+			if len(b) > 0 {
+				if _, werr := c.Write(s.framer.Encode(b)); werr != nil {
+					return
+				}
+			}
+			if err == regenbox.ErrClosedPort {
+				return
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+
+	// br is kept for the lifetime of the client: CobsFramer.Decode wraps
+	// any non-*bufio.Reader in a throwaway bufio.Reader per call, so a
+	// fresh one here would drop bytes already buffered past one frame's
+	// delimiter whenever two frames arrive in the same TCP segment.
+	br := bufio.NewReader(c)
+	for {
+		b, err := s.framer.Decode(br)
+		if err != nil {
+			break
+		}
+		if err := s.conn.Write(b); err != nil {
+			break
+		}
+	}
+
+	c.Close()
+	close(stop)
+
+	// Clear the client slot as soon as c is closed, without waiting on
+	// done: that goroutine reads s.conn, not c, so if the local box is
+	// mid-reconnect it can stay blocked in s.conn.Read() for up to
+	// Reconnect.GracePeriod after this client is long gone. Holding the
+	// slot open until <-done would reject every new client for that
+	// whole window over unrelated local-hardware state.
+	s.mu.Lock()
+	if s.client == c {
+		s.client = nil
+	}
+	s.mu.Unlock()
+	log.Printf("netserial: client %s detached", c.RemoteAddr())
+
+	<-done
+}
+
+// Close stops accepting clients and detaches the current one, if any.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.closeCh)
+	client := s.client
+	s.mu.Unlock()
+
+	if client != nil {
+		client.Close()
+	}
+	return s.ln.Close()
+}
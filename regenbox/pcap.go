@@ -0,0 +1,125 @@
+package regenbox
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// pcapMagic/pcapVersion identify a capture file written by PcapWriter,
+// read back by PcapReader. The format is deliberately tiny: a magic +
+// version header, then one record per mirrored read/write:
+//
+//	ns timestamp (int64) | direction (1 byte) | length (uint32) | payload
+const (
+	pcapMagic   uint32 = 0x676f7262 // "gorb"
+	pcapVersion uint16 = 1
+)
+
+var ErrBadPcapMagic = errors.New("regenbox: not a goregen serial capture")
+
+// PcapWriter implements MirrorWriter, persisting every mirrored record
+// to an underlying file in the format documented above so a session can
+// be replayed or decoded offline.
+type PcapWriter struct {
+	w *bufio.Writer
+	f *os.File
+}
+
+// NewPcapWriter creates (or truncates) path and writes the capture header.
+func NewPcapWriter(path string) (*PcapWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	pw := &PcapWriter{w: bufio.NewWriter(f), f: f}
+	if err := binary.Write(pw.w, binary.BigEndian, pcapMagic); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := binary.Write(pw.w, binary.BigEndian, pcapVersion); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *PcapWriter) WriteRecord(ns int64, dir Direction, payload []byte) error {
+	if err := binary.Write(pw.w, binary.BigEndian, ns); err != nil {
+		return err
+	}
+	if err := pw.w.WriteByte(byte(dir)); err != nil {
+		return err
+	}
+	if err := binary.Write(pw.w, binary.BigEndian, uint32(len(payload))); err != nil {
+		return err
+	}
+	if _, err := pw.w.Write(payload); err != nil {
+		return err
+	}
+	return pw.w.Flush()
+}
+
+// Close flushes and closes the underlying file.
+func (pw *PcapWriter) Close() error {
+	if err := pw.w.Flush(); err != nil {
+		pw.f.Close()
+		return err
+	}
+	return pw.f.Close()
+}
+
+// PcapRecord is one decoded record from a capture read by PcapReader.
+type PcapRecord struct {
+	Ns      int64
+	Dir     Direction
+	Payload []byte
+}
+
+// PcapReader decodes a capture written by PcapWriter.
+type PcapReader struct {
+	r *bufio.Reader
+}
+
+// NewPcapReader validates r's header and returns a reader positioned at
+// the first record.
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	br := bufio.NewReader(r)
+	var magic uint32
+	if err := binary.Read(br, binary.BigEndian, &magic); err != nil {
+		return nil, err
+	}
+	if magic != pcapMagic {
+		return nil, ErrBadPcapMagic
+	}
+	var version uint16
+	if err := binary.Read(br, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	return &PcapReader{r: br}, nil
+}
+
+// Next decodes the following record, returning io.EOF once the capture
+// is exhausted.
+func (pr *PcapReader) Next() (PcapRecord, error) {
+	var rec PcapRecord
+	if err := binary.Read(pr.r, binary.BigEndian, &rec.Ns); err != nil {
+		return rec, err
+	}
+	dir, err := pr.r.ReadByte()
+	if err != nil {
+		return rec, err
+	}
+	rec.Dir = Direction(dir)
+	var n uint32
+	if err := binary.Read(pr.r, binary.BigEndian, &n); err != nil {
+		return rec, err
+	}
+	rec.Payload = make([]byte, n)
+	if _, err := io.ReadFull(pr.r, rec.Payload); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
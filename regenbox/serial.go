@@ -1,10 +1,13 @@
 package regenbox
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"go.bug.st/serial.v1"
+	"io"
 	"log"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,6 +15,11 @@ import (
 var ErrNoSerialPortFound = errors.New("didn't find any available serial port")
 var ErrClosedPort = errors.New("serial port is closed")
 
+// ErrDisconnected is returned by Read/Write when the underlying serial port
+// has been lost and the reconnect grace period has elapsed without a
+// successful reconnect.
+var ErrDisconnected = errors.New("serial port disconnected")
+
 var DefaultSerialConfig = serial.Mode{
 	BaudRate: 57600,
 	Parity:   serial.NoParity,
@@ -21,28 +29,83 @@ var DefaultSerialConfig = serial.Mode{
 
 var DefaultTimeout = time.Second
 
+// DefaultReconnectConfig is used by NewSerial when no ReconnectConfig
+// is supplied by the caller.
+var DefaultReconnectConfig = ReconnectConfig{
+	Enabled:         true,
+	Interval:        time.Second * 2,
+	MaxBackoff:      time.Second * 30,
+	GracePeriod:     time.Minute,
+	PreferLastKnown: true,
+}
+
+// ReconnectConfig controls how SerialConnection behaves when the
+// underlying port is lost.
+type ReconnectConfig struct {
+	// Enabled turns on the supervising reconnect loop.
+	Enabled bool
+
+	// Interval is the delay between reconnect attempts, doubled after
+	// each failed attempt up to MaxBackoff.
+	Interval   time.Duration
+	MaxBackoff time.Duration
+
+	// GracePeriod is how long Read/Write block waiting for a reconnect
+	// before giving up with ErrDisconnected.
+	GracePeriod time.Duration
+
+	// PreferLastKnown re-opens sc.path before falling back to FindSerial.
+	PreferLastKnown bool
+}
+
+// connState describes the lifecycle of the underlying serial.Port, as
+// opposed to SerialConnection itself which may outlive several of them.
+type connState int
+
+const (
+	stateConnected connState = iota
+	stateDisconnected
+	stateClosed
+)
+
 type SerialConnection struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	Reconnect    ReconnectConfig
+
+	// Framer controls wire framing; it defaults to StopByteFramer via
+	// NewSerial for backward compatibility and may be swapped before Start.
+	Framer Framer
 
-	serial.Port
+	mu     sync.RWMutex
+	port   serial.Port
 	path   string
 	locked bool
 	config serial.Mode
+	state  connState
 
 	rdChan    chan []byte
 	wrChan    chan []byte
 	errChan   chan error
 	closeChan chan struct{}
-	wg        sync.WaitGroup
+	// disconnectedChan is recreated every time the connection drops, and
+	// closed again as soon as a replacement port is in place.
+	disconnectedChan chan struct{}
+	wg               sync.WaitGroup
+	superWg          sync.WaitGroup
+
+	// mirrorChan/mirrorStop back SetMirror; nil when no mirror is attached.
+	mirrorChan chan mirrorRecord
+	mirrorStop chan struct{}
 }
 
 func NewSerial(port serial.Port, config serial.Mode, name string, lockPort bool) *SerialConnection {
 	return &SerialConnection{
-		Port:      port,
+		port:      port,
 		locked:    lockPort,
 		path:      name,
 		config:    config,
+		state:     stateConnected,
 		rdChan:    make(chan []byte),
 		wrChan:    make(chan []byte),
 		errChan:   make(chan error),
@@ -50,11 +113,14 @@ func NewSerial(port serial.Port, config serial.Mode, name string, lockPort bool)
 
 		ReadTimeout:  DefaultTimeout,
 		WriteTimeout: DefaultTimeout,
+		Reconnect:    DefaultReconnectConfig,
+		Framer:       DefaultFramer,
 	}
 }
 
-// Start begins the two routines responsible
-// for reading and writing on serial port.
+// Start begins the two routines responsible for reading and writing on
+// the serial port, plus a supervisor that watches for unrecoverable I/O
+// errors and transparently reopens the port when Reconnect.Enabled is set.
 func (sc *SerialConnection) Start() {
 	sc.wg.Add(2)
 	go func() {
@@ -65,11 +131,24 @@ func (sc *SerialConnection) Start() {
 		sc.writeRoutine()
 		sc.wg.Done()
 	}()
+
+	if sc.Reconnect.Enabled {
+		sc.superWg.Add(1)
+		go func() {
+			sc.superviseRoutine()
+			sc.superWg.Done()
+		}()
+	}
 }
 
 // Read takes one of sc.rdChan or sc.errChan, waiting up to sc.ReadTimeout,
 // it also checks if connection is closed and returns error accordingly.
+// While the port is disconnected, Read blocks until a reconnect succeeds
+// or Reconnect.GracePeriod elapses, in which case it returns ErrDisconnected.
 func (sc *SerialConnection) Read() (b []byte, err error) {
+	if err = sc.waitReconnected(); err != nil {
+		return nil, err
+	}
 	select {
 	case b = <-sc.rdChan:
 		select {
@@ -86,7 +165,11 @@ func (sc *SerialConnection) Read() (b []byte, err error) {
 
 // Write pushes b to sc.wrChan, or returns an error
 // after sc.WriteTimeout, or if connection is closed.
+// While the port is disconnected, Write blocks like Read, see above.
 func (sc *SerialConnection) Write(b []byte) (err error) {
+	if err = sc.waitReconnected(); err != nil {
+		return err
+	}
 	select {
 	case sc.wrChan <- b:
 		select {
@@ -102,6 +185,28 @@ func (sc *SerialConnection) Write(b []byte) (err error) {
 	return err
 }
 
+// waitReconnected blocks while sc is disconnected, up to Reconnect.GracePeriod.
+func (sc *SerialConnection) waitReconnected() error {
+	sc.mu.RLock()
+	disconnected := sc.disconnectedChan
+	closed := sc.state == stateClosed
+	sc.mu.RUnlock()
+	if closed {
+		return ErrClosedPort
+	}
+	if disconnected == nil {
+		return nil
+	}
+	select {
+	case <-disconnected:
+		return nil
+	case <-sc.Closed():
+		return ErrClosedPort
+	case <-time.After(sc.Reconnect.GracePeriod):
+		return ErrDisconnected
+	}
+}
+
 // Close notifies read/write routines to stop, then waits
 // for them to return, it then actually closes serial port.
 func (sc *SerialConnection) Close() error {
@@ -110,9 +215,13 @@ func (sc *SerialConnection) Close() error {
 		return ErrClosedPort
 	default:
 	}
+	sc.mu.Lock()
+	sc.state = stateClosed
+	sc.mu.Unlock()
 	close(sc.closeChan)
-	err := sc.Port.Close()
+	err := sc.getPort().Close()
 	sc.wg.Wait()
+	sc.superWg.Wait()
 	return err
 }
 
@@ -127,25 +236,62 @@ func (sc *SerialConnection) Path() string {
 	return sc.path
 }
 
+// getPort returns the currently active serial.Port, which may have been
+// swapped in by superviseRoutine since Start was called.
+func (sc *SerialConnection) getPort() serial.Port {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.port
+}
+
+// isRecoverable reports whether err looks like a transient I/O hiccup
+// rather than the device going away (EOF, a closed handle, or the OS
+// reporting the USB device has been removed).
+func isRecoverable(err error) bool {
+	if err == nil {
+		return true
+	}
+	msg := err.Error()
+	switch {
+	case err == io.EOF:
+	case strings.Contains(msg, "file already closed"):
+	case strings.Contains(msg, "device not configured"):
+	case strings.Contains(msg, "no such device"):
+	case strings.Contains(msg, "input/output error"):
+	default:
+		return true
+	}
+	return false
+}
+
 func (sc *SerialConnection) readRoutine() {
+	pr := &portReader{sc: sc}
+	br := bufio.NewReader(pr)
 	for {
-		b := make([]byte, 32)
-		i, err := sc.Port.Read(b)
-
-		// read until last byte is a stop
-		j := i
-		for err == nil && j > 0 && b[i-1] != StopByte {
-			j, err = sc.Port.Read(b[i:])
-			i += j
-		}
+		b, err := sc.Framer.Decode(br)
 
-		// do not send stop-byte
-		if i > 0 && b[i-1] == StopByte {
-			i -= 1
+		if !isRecoverable(pr.lastErr) {
+			if sc.onDisconnect(pr.lastErr) {
+				// Wait for superviseRoutine to swap in a working port
+				// instead of busy-spinning Decode against a dead one.
+				sc.mu.RLock()
+				disconnected := sc.disconnectedChan
+				sc.mu.RUnlock()
+				select {
+				case <-disconnected:
+				case <-sc.Closed():
+					return
+				}
+				br.Reset(pr)
+				continue
+			}
+			return
 		}
+		// Raw wire bytes are already mirrored by portReader.Read as they
+		// come off the port, independent of whether Decode succeeds.
 
 		select {
-		case sc.rdChan <- b[:i]:
+		case sc.rdChan <- b:
 		case <-sc.Closed():
 			return
 		}
@@ -157,6 +303,28 @@ func (sc *SerialConnection) readRoutine() {
 	}
 }
 
+// portReader adapts sc's currently active serial.Port to io.Reader, so
+// Framer.Decode keeps working transparently across a reconnect. The
+// latest Read error is stashed for the caller to inspect, since Framer
+// implementations may wrap or swallow it (e.g. bufio.Reader.ReadBytes).
+type portReader struct {
+	sc      *SerialConnection
+	lastErr error
+}
+
+func (pr *portReader) Read(p []byte) (int, error) {
+	n, err := pr.sc.getPort().Read(p)
+	pr.lastErr = err
+	// Mirror the raw bytes as they actually came off the wire, not the
+	// Framer-decoded payload: that way a corrupted frame (bad CRC, a
+	// truncated COBS block) still shows up in a capture even though
+	// Framer.Decode never successfully hands it back as a payload.
+	if n > 0 {
+		pr.sc.tee(DirRead, p[:n])
+	}
+	return n, err
+}
+
 func (sc *SerialConnection) writeRoutine() {
 	var b []byte
 	for {
@@ -165,7 +333,28 @@ func (sc *SerialConnection) writeRoutine() {
 		case <-sc.Closed():
 			return
 		}
-		_, err := sc.Port.Write(b)
+		encoded := sc.Framer.Encode(b)
+		_, err := sc.getPort().Write(encoded)
+		if !isRecoverable(err) {
+			keepGoing := sc.onDisconnect(err)
+			// Always answer the write already pulled off wrChan, or its
+			// caller (bounded only by Reconnect.GracePeriod via
+			// waitReconnected) hangs forever, and a later write's answer
+			// could otherwise be cross-delivered to it instead.
+			select {
+			case sc.errChan <- ErrDisconnected:
+			case <-sc.Closed():
+				return
+			}
+			if keepGoing {
+				continue
+			}
+			return
+		}
+		// Mirror the raw encoded wire bytes, not the pre-encode payload,
+		// so a capture reflects exactly what was sent (framing and CRC
+		// included).
+		sc.tee(DirWrite, encoded)
 		select {
 		case sc.errChan <- err:
 		case <-sc.Closed():
@@ -174,6 +363,93 @@ func (sc *SerialConnection) writeRoutine() {
 	}
 }
 
+// onDisconnect marks sc as disconnected so Read/Write start blocking, and
+// wakes up superviseRoutine to start trying to reopen the port. It returns
+// false if sc has meanwhile been closed, in which case the caller should
+// return rather than loop.
+func (sc *SerialConnection) onDisconnect(cause error) bool {
+	select {
+	case <-sc.Closed():
+		return false
+	default:
+	}
+	sc.mu.Lock()
+	alreadyDisconnected := sc.state == stateDisconnected
+	sc.state = stateDisconnected
+	if sc.disconnectedChan == nil {
+		sc.disconnectedChan = make(chan struct{})
+	}
+	sc.mu.Unlock()
+	if !alreadyDisconnected {
+		log.Printf("serial \"%s\" disconnected: %s", sc.path, cause)
+	}
+	return true
+}
+
+// superviseRoutine watches for SerialConnection.state going disconnected
+// and periodically tries to reopen the port, preferring sc.path before
+// falling back to a full FindSerial scan.
+func (sc *SerialConnection) superviseRoutine() {
+	backoff := sc.Reconnect.Interval
+	for {
+		sc.mu.RLock()
+		disconnected := sc.state == stateDisconnected
+		sc.mu.RUnlock()
+
+		if !disconnected {
+			backoff = sc.Reconnect.Interval
+			select {
+			case <-sc.Closed():
+				return
+			case <-time.After(sc.Reconnect.Interval):
+				continue
+			}
+		}
+
+		port, err := sc.reopen()
+		if err != nil {
+			select {
+			case <-sc.Closed():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > sc.Reconnect.MaxBackoff {
+				backoff = sc.Reconnect.MaxBackoff
+			}
+			continue
+		}
+
+		sc.mu.Lock()
+		sc.port = port
+		sc.state = stateConnected
+		pending := sc.disconnectedChan
+		sc.disconnectedChan = nil
+		sc.mu.Unlock()
+		if pending != nil {
+			close(pending)
+		}
+		backoff = sc.Reconnect.Interval
+		log.Printf("serial \"%s\" reconnected", sc.path)
+	}
+}
+
+// reopen tries sc.path first (if Reconnect.PreferLastKnown), then falls
+// back to scanning every available port for a responsive regenbox.
+func (sc *SerialConnection) reopen() (serial.Port, error) {
+	if sc.Reconnect.PreferLastKnown && sc.path != "" {
+		if port, err := serial.Open(sc.path, &sc.config); err == nil {
+			return port, nil
+		}
+	}
+	found, err := FindSerial(&sc.config)
+	if err != nil {
+		return nil, err
+	}
+	found.Close()
+	return serial.Open(found.path, &sc.config)
+}
+
 // FindSerial tries to connect to first available serial port (platform independant hopefully).
 // If config is nil, DefaultSerialMode is used.
 func FindSerial(config *serial.Mode) (*SerialConnection, error) {
@@ -192,6 +468,7 @@ func FindSerial(config *serial.Mode) (*SerialConnection, error) {
 			conn := NewSerial(port, *config, v, false)
 			conn.ReadTimeout = time.Millisecond * 50
 			conn.WriteTimeout = time.Millisecond * 50
+			conn.Reconnect.Enabled = false
 			conn.Start()
 			// create a temporary box to test connection
 			rb := &RegenBox{Conn: conn, config: new(Config), state: Connected}
@@ -0,0 +1,91 @@
+package regenbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// configMus holds one *sync.RWMutex per RegenBox guarding its config
+// field, since RegenBox itself (defined elsewhere) carries no lock of
+// its own. Entries are never evicted; a process manages at most a
+// handful of RegenBoxes for its lifetime, so this is not worth the
+// bookkeeping.
+var configMus sync.Map // map[*RegenBox]*sync.RWMutex
+
+func configMuFor(rb *RegenBox) *sync.RWMutex {
+	mu, _ := configMus.LoadOrStore(rb, new(sync.RWMutex))
+	return mu.(*sync.RWMutex)
+}
+
+// Config returns rb's current charging parameters. A charge/discharge
+// cycle reading its config on the hot path should go through Config
+// rather than the unexported field directly, so it shares the same
+// lock UpdateConfig takes around a swap instead of racing it.
+func (rb *RegenBox) Config() *Config {
+	mu := configMuFor(rb)
+	mu.RLock()
+	defer mu.RUnlock()
+	return rb.config
+}
+
+// UpdateConfig swaps rb's charging parameters for newCfg. It is meant to
+// be called between cycles (e.g. from a SIGHUP handler after rereading
+// the TOML config), not while a charge/discharge is in progress; the
+// swap takes the same lock Config reads under, so a cycle reading its
+// config via Config can't observe a torn or concurrently-replaced value.
+func (rb *RegenBox) UpdateConfig(newCfg *Config) error {
+	mu := configMuFor(rb)
+	mu.Lock()
+	defer mu.Unlock()
+	rb.config = newCfg
+	return nil
+}
+
+// StopContext stops rb like Stop, but returns as soon as ctx is done even
+// if the underlying shutdown hasn't finished, letting the caller report
+// which stage of a multi-layer shutdown timed out.
+func (rb *RegenBox) StopContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		rb.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("regenbox: stop timed out: %w", ctx.Err())
+	}
+}
+
+// StopContext is the Watcher equivalent of RegenBox.StopContext.
+func (w *Watcher) StopContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("regenbox: watcher stop timed out: %w", ctx.Err())
+	}
+}
+
+// CloseContext is the SerialConnection equivalent of RegenBox.StopContext.
+func (sc *SerialConnection) CloseContext(ctx context.Context) error {
+	done := make(chan struct{})
+	var err error
+	go func() {
+		err = sc.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("regenbox: conn close timed out: %w", ctx.Err())
+	}
+}